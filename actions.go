@@ -0,0 +1,78 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package mirbft
+
+import pb "github.com/IBM/mirbft/mirbftpb"
+
+// Unicast is a Msg destined for exactly one replica.
+type Unicast struct {
+	Target uint64
+	Msg    *pb.Msg
+}
+
+// Batch is a set of preprocessed proposals allocated to a seqno/epoch,
+// awaiting hashing and validation before it can be prepared.
+type Batch struct {
+	SeqNo     uint64
+	Epoch     uint64
+	Proposals []*PreprocessResult
+}
+
+// PreprocessResult pairs a client proposal with the digest computed for it.
+type PreprocessResult struct {
+	Proposal *pb.Request
+	Digest   []byte
+}
+
+// ProcessResult pairs a Batch with the digest computed over its proposals'
+// digests, and whether validation found it invalid.
+type ProcessResult struct {
+	Batch   *Batch
+	Digest  []byte
+	Invalid bool
+}
+
+// CheckpointResult reports the application-level state value taken at
+// SeqNo, once every preceding entry has committed.
+type CheckpointResult struct {
+	SeqNo uint64
+	Value []byte
+}
+
+// Actions is the set of side effects the state machine asks its caller to
+// perform: messages to send, proposals to hash and validate, entries to
+// apply, checkpoints and snapshots to take, snapshots to restore, and
+// timers to arm or cancel.
+type Actions struct {
+	Broadcast []*pb.Msg
+	Unicast   []*Unicast
+
+	Preprocess []*pb.Request
+	Process    []*Batch
+
+	QEntries []*pb.QEntry
+	PEntries []*pb.PEntry
+
+	Commit     []*pb.QEntry
+	Checkpoint []uint64
+
+	Timers       []Timer
+	TimerCancels []TimerCancel
+
+	SnapshotRequest *SnapshotRequest
+	SnapshotRestore *SnapshotRestore
+}
+
+// ActionResults carries the results of performing an Actions back into the
+// state machine.
+type ActionResults struct {
+	Preprocesses []PreprocessResult
+	Processed    []ProcessResult
+	Checkpoints  []*CheckpointResult
+
+	SnapshotResult *SnapshotResult
+}
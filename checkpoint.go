@@ -0,0 +1,95 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package mirbft
+
+import (
+	"bytes"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+)
+
+// checkpointTracker collects the Checkpoint values replicas broadcast for
+// each seqno, so a replica can tell a checkpoint is stable (f+1 replicas,
+// including itself, agree on the same Value) before asking the application
+// to snapshot it. Only votes matching this replica's own Value are counted;
+// votes for a different Value are recorded but never compared with each
+// other, so the tracker does not detect that its own checkpoint disagrees
+// with a value other replicas hold, and does not start state transfer.
+type checkpointTracker struct {
+	networkConfig *pb.NetworkConfig
+
+	// votes[seqNo][source] is the Value that source reported via a
+	// Checkpoint message for seqNo.
+	votes map[uint64]map[NodeID][]byte
+
+	// own[seqNo] is the Value this replica's own commit path produced for
+	// seqNo, via a CheckpointResult.
+	own map[uint64][]byte
+
+	// requested tracks the seqnos a SnapshotRequest has already been armed
+	// for, so a checkpoint that was already stable doesn't re-request a
+	// snapshot every time another matching vote arrives.
+	requested map[uint64]bool
+}
+
+func newCheckpointTracker(networkConfig *pb.NetworkConfig) *checkpointTracker {
+	return &checkpointTracker{
+		networkConfig: networkConfig,
+		votes:         map[uint64]map[NodeID][]byte{},
+		own:           map[uint64][]byte{},
+		requested:     map[uint64]bool{},
+	}
+}
+
+// applyOwn records this replica's own CheckpointResult for seqNo and
+// reports whether it's now known to be stable.
+func (ct *checkpointTracker) applyOwn(seqNo uint64, value []byte) bool {
+	ct.own[seqNo] = value
+	return ct.checkStable(seqNo)
+}
+
+// applyVote records a peer's Checkpoint message and reports whether seqNo
+// is now known to be stable.
+func (ct *checkpointTracker) applyVote(source NodeID, seqNo uint64, value []byte) bool {
+	bySource, ok := ct.votes[seqNo]
+	if !ok {
+		bySource = map[NodeID][]byte{}
+		ct.votes[seqNo] = bySource
+	}
+	bySource[source] = value
+	return ct.checkStable(seqNo)
+}
+
+// checkStable reports whether seqNo has just become stable, i.e. this is
+// the first call at which our own Value for seqNo is corroborated by at
+// least F other replicas' votes for the same Value.
+func (ct *checkpointTracker) checkStable(seqNo uint64) bool {
+	if ct.requested[seqNo] {
+		return false
+	}
+
+	own, ok := ct.own[seqNo]
+	if !ok {
+		return false
+	}
+
+	matching := 0
+	for _, value := range ct.votes[seqNo] {
+		if bytes.Equal(value, own) {
+			matching++
+		}
+	}
+
+	if matching < ct.networkConfig.F {
+		return false
+	}
+
+	ct.requested[seqNo] = true
+	delete(ct.votes, seqNo)
+	delete(ct.own, seqNo)
+	return true
+}
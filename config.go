@@ -0,0 +1,40 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package mirbft
+
+import "time"
+
+// NodeID identifies a replica within the network.
+type NodeID uint64
+
+// BucketID identifies one of the totalBuckets request buckets requests are
+// partitioned into for proposing.
+type BucketID uint64
+
+// BatchParameters governs when a proposer cuts a bucket's queued requests
+// into a batch ready to propose.
+type BatchParameters struct {
+	// CutSizeBytes cuts a batch once its queued requests' data reaches this
+	// many bytes.
+	CutSizeBytes int
+
+	// CutMaxCount cuts a batch once it holds this many requests, even if
+	// CutSizeBytes hasn't been reached.
+	CutMaxCount int
+
+	// CutMaxDuration cuts a batch this long after its first request was
+	// queued, even if it never grows large enough to hit CutSizeBytes or
+	// CutMaxCount. This bounds the latency a request can sit idle under low
+	// load.
+	CutMaxDuration time.Duration
+}
+
+// Config holds the local configuration of a single replica.
+type Config struct {
+	ID              uint64
+	BatchParameters BatchParameters
+}
@@ -0,0 +1,143 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package mirbftpb defines the wire messages exchanged between mirbft
+// replicas.
+package mirbftpb
+
+// NetworkConfig describes the static parameters of the replica set that
+// must be agreed upon out of band before the network can reach consensus.
+type NetworkConfig struct {
+	Nodes []uint64
+	F     int
+
+	// CheckpointInterval is the number of sequence numbers between
+	// checkpoints. Log windows are sized as a small multiple of it, so
+	// committed-but-not-yet-checkpointed entries always fit.
+	CheckpointInterval uint64
+}
+
+// Request is a single client request, as handed to the state machine for
+// preprocessing.
+type Request struct {
+	Data []byte
+}
+
+// QEntry is a single pre-prepared (quorum) log entry.
+type QEntry struct {
+	SeqNo     uint64
+	Epoch     uint64
+	Digest    []byte
+	Proposals []*Request
+}
+
+// PEntry is a single prepared log entry.
+type PEntry struct {
+	SeqNo  uint64
+	Epoch  uint64
+	Digest []byte
+}
+
+// Prepare is broadcast once a replica has preprepared a batch.
+type Prepare struct {
+	SeqNo  uint64
+	Epoch  uint64
+	Digest []byte
+}
+
+// Commit is broadcast once a replica has collected a quorum of Prepares.
+type Commit struct {
+	SeqNo  uint64
+	Epoch  uint64
+	Digest []byte
+}
+
+// Checkpoint is broadcast once a replica's SerialCommitter (or equivalent)
+// takes a checkpoint, so peers can confirm it's stable (i.e. f+1 replicas
+// agree on Value) before any of them asks the application to snapshot it.
+type Checkpoint struct {
+	SeqNo uint64
+	Value []byte
+}
+
+// StateTransferRequest asks a peer for the snapshot it advertised at SeqNo.
+type StateTransferRequest struct {
+	SeqNo uint64
+}
+
+// StateTransferChunk carries one piece of the snapshot a peer previously
+// asked for via StateTransferRequest.
+type StateTransferChunk struct {
+	SeqNo uint64
+	Data  []byte
+}
+
+// StateTransferDone marks the final chunk of a snapshot transfer for SeqNo;
+// once received, the requester has every chunk and can assemble them.
+type StateTransferDone struct {
+	SeqNo uint64
+}
+
+// StateTransfer is the request/chunk/done exchange a replica uses to pull a
+// snapshot from a peer during state transfer.
+type StateTransfer struct {
+	Type isStateTransfer_Type
+}
+
+type isStateTransfer_Type interface {
+	isStateTransfer_Type()
+}
+
+type StateTransfer_Request struct {
+	Request *StateTransferRequest
+}
+
+func (*StateTransfer_Request) isStateTransfer_Type() {}
+
+type StateTransfer_Chunk struct {
+	Chunk *StateTransferChunk
+}
+
+func (*StateTransfer_Chunk) isStateTransfer_Type() {}
+
+type StateTransfer_Done struct {
+	Done *StateTransferDone
+}
+
+func (*StateTransfer_Done) isStateTransfer_Type() {}
+
+// Msg is the envelope for every message exchanged between replicas.
+type Msg struct {
+	Type isMsg_Type
+}
+
+type isMsg_Type interface {
+	isMsg_Type()
+}
+
+type Msg_Prepare struct {
+	Prepare *Prepare
+}
+
+func (*Msg_Prepare) isMsg_Type() {}
+
+type Msg_Commit struct {
+	Commit *Commit
+}
+
+func (*Msg_Commit) isMsg_Type() {}
+
+type Msg_Checkpoint struct {
+	Checkpoint *Checkpoint
+}
+
+func (*Msg_Checkpoint) isMsg_Type() {}
+
+type Msg_StateTransfer struct {
+	StateTransfer *StateTransfer
+}
+
+func (*Msg_StateTransfer) isMsg_Type() {}
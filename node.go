@@ -0,0 +1,275 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package mirbft
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+)
+
+// Replica is a peer's static identity within the network.
+type Replica struct {
+	ID uint64
+}
+
+// Hasher computes a digest over arbitrary bytes, e.g. for verifying a
+// pulled snapshot against the CheckpointResult.Value that triggered state
+// transfer.
+type Hasher interface {
+	Hash([]byte) []byte
+}
+
+// Status is a point-in-time snapshot of a Node's internal state, for
+// debugging and observability.
+type Status struct {
+	PendingTimers []string
+}
+
+// Pretty renders Status for inclusion in crash/debug output.
+func (s *Status) Pretty() string {
+	return fmt.Sprintf("pending timers: %v", s.PendingTimers)
+}
+
+// Node drives the consensus state machine for a single replica.
+type Node struct {
+	Config        *Config
+	NetworkConfig *pb.NetworkConfig
+	Replicas      []*Replica
+	Hasher        Hasher
+
+	proposer    *proposer
+	checkpoints *checkpointTracker
+
+	transfer  *stateTransfer
+	snapshots map[uint64][]byte
+
+	// pendingActions accumulates Actions produced by Step calls until the
+	// caller drains them via Actions.
+	pendingActions []*Actions
+}
+
+// NewNode constructs a Node for the given replica set and initial bucket
+// assignment.
+func NewNode(myConfig *Config, networkConfig *pb.NetworkConfig, requestWindows map[NodeID]*requestWindow, buckets map[BucketID]NodeID) *Node {
+	return &Node{
+		Config:        myConfig,
+		NetworkConfig: networkConfig,
+		proposer:      newProposer(myConfig, requestWindows, buckets, nil),
+		checkpoints:   newCheckpointTracker(networkConfig),
+	}
+}
+
+// Step applies an incoming message from source into the state machine. Any
+// Actions it produces are collected separately via calls to Actions rather
+// than returned here, matching how Broadcast/Unicast delivery
+// itself is a fire-and-forget call on the Link.
+func (n *Node) Step(ctx context.Context, source uint64, msg *pb.Msg) error {
+	switch t := msg.Type.(type) {
+	case *pb.Msg_Checkpoint:
+		n.pendingActions = append(n.pendingActions, n.applyCheckpointVote(NodeID(source), t.Checkpoint))
+	case *pb.Msg_StateTransfer:
+		n.pendingActions = append(n.pendingActions, n.applyStateTransfer(NodeID(source), t.StateTransfer))
+	}
+
+	return nil
+}
+
+// applyCheckpointVote folds a peer's Checkpoint broadcast into the
+// checkpoint tracker, arming a SnapshotRequest the moment our own
+// checkpoint at that seqno is corroborated by F matching votes from other
+// replicas (f+1 replicas in all, counting ourselves). Our own broadcast,
+// delivered back to us, is not counted as a vote; our own value is already
+// recorded via ApplyActionResults.
+func (n *Node) applyCheckpointVote(source NodeID, cp *pb.Checkpoint) *Actions {
+	if source == NodeID(n.Config.ID) {
+		return &Actions{}
+	}
+	if !n.checkpoints.applyVote(source, cp.SeqNo, cp.Value) {
+		return &Actions{}
+	}
+	return &Actions{SnapshotRequest: &SnapshotRequest{SeqNo: cp.SeqNo}}
+}
+
+// BeginStateTransfer starts pulling the snapshot taken at targetSeqNo (to be
+// verified against targetValue, the CheckpointResult.Value this replica
+// couldn't verify locally) from sources.
+func (n *Node) BeginStateTransfer(targetSeqNo uint64, targetValue []byte, sources []NodeID) *Actions {
+	n.transfer = newStateTransfer(n.Config, targetSeqNo, targetValue, sources)
+
+	unicasts := make([]*Unicast, 0, len(sources))
+	for _, source := range sources {
+		unicasts = append(unicasts, stateTransferUnicast(uint64(source), &pb.StateTransfer{
+			Type: &pb.StateTransfer_Request{
+				Request: &pb.StateTransferRequest{SeqNo: targetSeqNo},
+			},
+		}))
+	}
+
+	return &Actions{Unicast: unicasts}
+}
+
+func (n *Node) applyStateTransfer(source NodeID, st *pb.StateTransfer) *Actions {
+	switch t := st.Type.(type) {
+	case *pb.StateTransfer_Request:
+		data, ok := n.snapshots[t.Request.SeqNo]
+		if !ok {
+			return &Actions{}
+		}
+
+		return &Actions{
+			Unicast: []*Unicast{
+				stateTransferUnicast(uint64(source), &pb.StateTransfer{
+					Type: &pb.StateTransfer_Chunk{
+						Chunk: &pb.StateTransferChunk{SeqNo: t.Request.SeqNo, Data: data},
+					},
+				}),
+				stateTransferUnicast(uint64(source), &pb.StateTransfer{
+					Type: &pb.StateTransfer_Done{
+						Done: &pb.StateTransferDone{SeqNo: t.Request.SeqNo},
+					},
+				}),
+			},
+		}
+
+	case *pb.StateTransfer_Chunk:
+		if n.transfer == nil {
+			return &Actions{}
+		}
+		n.transfer.addChunk(source, t.Chunk.Data)
+		return &Actions{}
+
+	case *pb.StateTransfer_Done:
+		if n.transfer == nil || !n.transfer.isSource(source) {
+			return &Actions{}
+		}
+
+		assembled := n.transfer.finish(source)
+
+		if n.Hasher != nil && !bytes.Equal(n.Hasher.Hash(assembled), n.transfer.targetValue) {
+			// Digest mismatch: a stale or malicious source served us
+			// garbage. Drop its chunks and keep waiting for one of the
+			// other f+1 sources, which were all asked at once.
+			delete(n.transfer.chunks, source)
+			return &Actions{}
+		}
+
+		n.transfer = nil
+		return &Actions{SnapshotRestore: &SnapshotRestore{Data: assembled}}
+	}
+
+	return &Actions{}
+}
+
+func stateTransferUnicast(target uint64, st *pb.StateTransfer) *Unicast {
+	return &Unicast{
+		Target: target,
+		Msg:    &pb.Msg{Type: &pb.Msg_StateTransfer{StateTransfer: st}},
+	}
+}
+
+// ApplyActionResults folds the results of performing an Actions back into
+// Node's state: caching a freshly produced snapshot so it can be served to
+// a peer that later calls BeginStateTransfer against us, and broadcasting
+// each new CheckpointResult so peers can confirm it's stable.
+func (n *Node) ApplyActionResults(results *ActionResults) {
+	if results.SnapshotResult != nil {
+		if n.snapshots == nil {
+			n.snapshots = map[uint64][]byte{}
+		}
+		n.snapshots[results.SnapshotResult.SeqNo] = results.SnapshotResult.Data
+	}
+
+	for _, checkpoint := range results.Checkpoints {
+		actions := &Actions{
+			Broadcast: []*pb.Msg{
+				{
+					Type: &pb.Msg_Checkpoint{
+						Checkpoint: &pb.Checkpoint{SeqNo: checkpoint.SeqNo, Value: checkpoint.Value},
+					},
+				},
+			},
+		}
+
+		if n.checkpoints.applyOwn(checkpoint.SeqNo, checkpoint.Value) {
+			actions.SnapshotRequest = &SnapshotRequest{SeqNo: checkpoint.SeqNo}
+		}
+
+		n.pendingActions = append(n.pendingActions, actions)
+	}
+}
+
+// RestoreWatermarks reinitializes this Node's proposer against the seqno a
+// just-installed snapshot (per a SnapshotRestore action) was taken at.
+func (n *Node) RestoreWatermarks(snapshotSeqNo uint64) {
+	if n.proposer == nil {
+		return
+	}
+	restoreWatermarks(n.proposer, snapshotSeqNo)
+}
+
+// NewEpoch rebuilds this Node's proposer from scratch against a new bucket
+// assignment and request windows, e.g. after a view change. Any idle-flush
+// timers still armed on the outgoing proposer are cancelled rather than
+// left dangling; the resulting TimerCancels surface on the next call to
+// Actions.
+func (n *Node) NewEpoch(requestWindows map[NodeID]*requestWindow, buckets map[BucketID]NodeID) {
+	n.proposer = newProposer(n.Config, requestWindows, buckets, n.proposer)
+}
+
+// ReassignBuckets moves this Node's proposer to a new bucket->leader map
+// without an epoch change, migrating already-queued requests to their new
+// owning bucket rather than rebuilding the proposer (and its request
+// windows) from scratch via NewEpoch.
+func (n *Node) ReassignBuckets(buckets map[BucketID]NodeID) {
+	n.proposer = n.proposer.migrateBuckets(n.Config, buckets)
+}
+
+// TimerFired delivers a Timer armed via Actions.Timers back into the state
+// machine once it has elapsed.
+func (n *Node) TimerFired(tag string) {
+	if n.proposer == nil {
+		return
+	}
+	n.proposer.TimerFired(tag)
+}
+
+// Status reports a point-in-time snapshot of this Node's internal state.
+func (n *Node) Status(ctx context.Context) (*Status, error) {
+	status := &Status{}
+	if n.proposer != nil {
+		status.PendingTimers = n.proposer.PendingTimers()
+	}
+	return status, nil
+}
+
+// Actions drains and merges every Actions produced by Step calls since the
+// last call to Actions, along with any idle-flush Timers/TimerCancels the
+// proposer has queued up.
+func (n *Node) Actions() *Actions {
+	merged := &Actions{}
+	for _, a := range n.pendingActions {
+		merged.Broadcast = append(merged.Broadcast, a.Broadcast...)
+		merged.Unicast = append(merged.Unicast, a.Unicast...)
+		if a.SnapshotRequest != nil {
+			merged.SnapshotRequest = a.SnapshotRequest
+		}
+		if a.SnapshotRestore != nil {
+			merged.SnapshotRestore = a.SnapshotRestore
+		}
+	}
+	n.pendingActions = nil
+
+	if n.proposer != nil {
+		merged.Timers = n.proposer.Timers()
+		merged.TimerCancels = n.proposer.Cancels()
+	}
+
+	return merged
+}
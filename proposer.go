@@ -6,7 +6,11 @@ SPDX-License-Identifier: Apache-2.0
 
 package mirbft
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+)
 
 func uint64ToBytes(value uint64) []byte {
 	byteValue := make([]byte, 8)
@@ -14,16 +18,15 @@ func uint64ToBytes(value uint64) []byte {
 	return byteValue
 }
 
-func bytesToUint64(value []byte) uint64 {
-	return binary.LittleEndian.Uint64(value)
-}
-
 type proposer struct {
 	myConfig                *Config
 	requestWindowProcessors map[NodeID]*requestWindowProcessor
 
 	totalBuckets    int
 	proposalBuckets map[BucketID]*proposalBucket
+
+	armedTimers    []Timer
+	pendingCancels []TimerCancel
 }
 
 type requestWindowProcessor struct {
@@ -35,9 +38,19 @@ type proposalBucket struct {
 	queue     []*request
 	sizeBytes int
 	pending   [][]*request
+
+	// timerTag is non-empty while an idle-flush timer is armed for this
+	// bucket, i.e. while queue holds requests that haven't yet grown large
+	// enough to cut on their own.
+	timerTag string
 }
 
-func newProposer(myConfig *Config, requestWindows map[NodeID]*requestWindow, buckets map[BucketID]NodeID) *proposer {
+// newProposer builds a proposer for the given bucket assignment. If previous
+// is non-nil (i.e. this isn't the first epoch), its still-armed idle-flush
+// timers are cancelled rather than left dangling against state this new
+// proposer doesn't share; the resulting TimerCancels are available via
+// Cancels() on the returned proposer.
+func newProposer(myConfig *Config, requestWindows map[NodeID]*requestWindow, buckets map[BucketID]NodeID, previous *proposer) *proposer {
 	proposalBuckets := map[BucketID]*proposalBucket{}
 	for bucketID, nodeID := range buckets {
 		if nodeID != NodeID(myConfig.ID) {
@@ -55,11 +68,105 @@ func newProposer(myConfig *Config, requestWindows map[NodeID]*requestWindow, buc
 		requestWindowProcessors[nodeID] = rwp
 	}
 
+	var pendingCancels []TimerCancel
+	if previous != nil {
+		pendingCancels = previous.Cancel()
+	}
+
 	return &proposer{
 		myConfig:                myConfig,
 		requestWindowProcessors: requestWindowProcessors,
 		proposalBuckets:         proposalBuckets,
 		totalBuckets:            len(buckets),
+		pendingCancels:          pendingCancels,
+	}
+}
+
+// assignBucket picks the bucket owning digest via rendezvous (HRW) hashing:
+// it scores digest against every bucket and returns the one with the
+// highest score. Unlike BucketID(digest % totalBuckets), this keeps roughly
+// 1/totalBuckets of assignments stable when totalBuckets changes across
+// epochs, instead of reshuffling essentially everything.
+func (p *proposer) assignBucket(digest []byte) BucketID {
+	var best BucketID
+	var bestScore uint64
+	for i := 0; i < p.totalBuckets; i++ {
+		bucket := BucketID(i)
+		if score := rendezvousScore(digest, bucket); score >= bestScore {
+			bestScore = score
+			best = bucket
+		}
+	}
+	return best
+}
+
+func rendezvousScore(digest []byte, bucket BucketID) uint64 {
+	h := fnv.New64a()
+	h.Write(digest)
+	h.Write(uint64ToBytes(uint64(bucket)))
+	return h.Sum64()
+}
+
+// migrateBuckets rebuilds proposalBuckets for a new bucket->leader map
+// without discarding already-queued requests wholesale the way constructing
+// a fresh proposer via newProposer would. Every queued and pending request
+// is re-scored with assignBucket against the new totalBuckets; requests that
+// land on a bucket we still lead move into it, and requests that now belong
+// to a peer are dropped rather than proposed on their behalf.
+func (p *proposer) migrateBuckets(myConfig *Config, buckets map[BucketID]NodeID) *proposer {
+	next := &proposer{
+		myConfig:                myConfig,
+		requestWindowProcessors: p.requestWindowProcessors,
+		proposalBuckets:         map[BucketID]*proposalBucket{},
+		totalBuckets:            len(buckets),
+		// Every queue is about to be rehashed against the new totalBuckets
+		// below, so whatever idle-flush timers were armed against the old
+		// layout are no longer meaningful; cancel them up front rather than
+		// leaving them armed against buckets that may no longer exist.
+		pendingCancels: p.Cancel(),
+	}
+
+	for bucketID, nodeID := range buckets {
+		if nodeID != NodeID(myConfig.ID) {
+			continue
+		}
+		next.proposalBuckets[bucketID] = &proposalBucket{}
+	}
+
+	for _, old := range p.proposalBuckets {
+		for _, requests := range old.pending {
+			next.migrateRequests(requests)
+		}
+		next.migrateRequests(old.queue)
+	}
+
+	return next
+}
+
+func (p *proposer) migrateRequests(requests []*request) {
+	for _, req := range requests {
+		bucket := p.assignBucket(req.preprocessResult.Digest)
+		target, ok := p.proposalBuckets[bucket]
+		if !ok {
+			// Now owned by a peer; drop it rather than proposing on their
+			// behalf. The originating node will re-propose it.
+			continue
+		}
+
+		if len(target.queue) == 0 && target.timerTag == "" {
+			target.timerTag = fmt.Sprintf("proposer-cut-%d-migrated-%x", bucket, req.preprocessResult.Digest)
+			p.armedTimers = append(p.armedTimers, Timer{
+				Tag:      target.timerTag,
+				Duration: p.myConfig.BatchParameters.CutMaxDuration,
+			})
+		}
+
+		target.queue = append(target.queue, req)
+		target.sizeBytes += len(req.preprocessResult.Proposal.Data)
+		if target.sizeBytes >= p.myConfig.BatchParameters.CutSizeBytes ||
+			len(target.queue) >= p.myConfig.BatchParameters.CutMaxCount {
+			p.cut(bucket)
+		}
 	}
 }
 
@@ -77,22 +184,122 @@ func (p *proposer) stepRequestWindow(nodeID NodeID) {
 
 		rwp.lastProcessed++
 
-		bucket := BucketID(bytesToUint64(request.preprocessResult.Digest) % uint64(p.totalBuckets))
+		bucket := p.assignBucket(request.preprocessResult.Digest)
 		proposalBucket, ok := p.proposalBuckets[bucket]
 		if !ok {
 			// I don't lead this bucket this epoch
 			continue
 		}
 
+		if len(proposalBucket.queue) == 0 && proposalBucket.timerTag == "" {
+			proposalBucket.timerTag = fmt.Sprintf("proposer-cut-%d-%d", bucket, rwp.lastProcessed)
+			p.armedTimers = append(p.armedTimers, Timer{
+				Tag:      proposalBucket.timerTag,
+				Duration: p.myConfig.BatchParameters.CutMaxDuration,
+			})
+		}
+
 		proposalBucket.queue = append(proposalBucket.queue, request)
 		proposalBucket.sizeBytes += len(request.preprocessResult.Proposal.Data)
-		if proposalBucket.sizeBytes >= p.myConfig.BatchParameters.CutSizeBytes {
-			proposalBucket.pending = append(proposalBucket.pending, proposalBucket.queue)
-			proposalBucket.queue = nil
-			proposalBucket.sizeBytes = 0
+		if proposalBucket.sizeBytes >= p.myConfig.BatchParameters.CutSizeBytes ||
+			len(proposalBucket.queue) >= p.myConfig.BatchParameters.CutMaxCount {
+			p.cut(bucket)
+		}
+	}
+
+}
+
+// cut promotes whatever is queued for bucket into pending and disarms its
+// idle-flush timer, if one is armed. It is a no-op if nothing is queued.
+func (p *proposer) cut(bucket BucketID) {
+	proposalBucket := p.proposalBuckets[bucket]
+	if len(proposalBucket.queue) == 0 {
+		return
+	}
+
+	proposalBucket.pending = append(proposalBucket.pending, proposalBucket.queue)
+	proposalBucket.queue = nil
+	proposalBucket.sizeBytes = 0
+
+	if proposalBucket.timerTag != "" {
+		found := false
+		for i, t := range p.armedTimers {
+			if t.Tag == proposalBucket.timerTag {
+				// Not drained via Timers() yet, so there's no point handing
+				// the caller an arm request for a timer we no longer need;
+				// drop it rather than making them cancel it a moment later.
+				p.armedTimers = append(p.armedTimers[:i], p.armedTimers[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			// Already drained via Timers(), so the caller has a real timer
+			// armed against this tag; tell them to cancel it.
+			p.pendingCancels = append(p.pendingCancels, TimerCancel{Tag: proposalBucket.timerTag})
+		}
+		proposalBucket.timerTag = ""
+	}
+}
+
+// Timers drains the idle-flush timers armed since the last call, so the
+// caller (mirbft.Node) can schedule them alongside the rest of an epoch's
+// Actions.
+func (p *proposer) Timers() []Timer {
+	armed := p.armedTimers
+	p.armedTimers = nil
+	return armed
+}
+
+// Cancels drains the TimerCancels queued up by newProposer/migrateBuckets
+// cancelling a predecessor's armed timers, by cut disarming a timer the
+// caller already holds, and by restoreWatermarks, so the caller (mirbft.Node) can
+// schedule them alongside the rest of an epoch's Actions.
+func (p *proposer) Cancels() []TimerCancel {
+	cancels := p.pendingCancels
+	p.pendingCancels = nil
+	return cancels
+}
+
+// TimerFired cuts whatever is queued for the bucket whose idle-flush timer
+// just expired. If the bucket already got cut for another reason (size or
+// count) before the timer fired, its timerTag will already be empty and
+// this is a no-op.
+func (p *proposer) TimerFired(tag string) {
+	for bucket, proposalBucket := range p.proposalBuckets {
+		if proposalBucket.timerTag == tag {
+			p.cut(bucket)
+			return
+		}
+	}
+}
+
+// PendingTimers reports the tags of all currently armed idle-flush timers,
+// for inclusion in Node.Status.
+func (p *proposer) PendingTimers() []string {
+	tags := make([]string, 0, len(p.proposalBuckets))
+	for _, proposalBucket := range p.proposalBuckets {
+		if proposalBucket.timerTag != "" {
+			tags = append(tags, proposalBucket.timerTag)
 		}
 	}
+	return tags
+}
 
+// Cancel returns a TimerCancel for every timer currently armed on p and
+// disarms them. newProposer and migrateBuckets both call this on the
+// outgoing proposer before replacing it, so that an epoch change or bucket
+// reassignment doesn't leave stale timers armed against state that no
+// longer exists.
+func (p *proposer) Cancel() []TimerCancel {
+	cancels := make([]TimerCancel, 0, len(p.proposalBuckets))
+	for _, proposalBucket := range p.proposalBuckets {
+		if proposalBucket.timerTag != "" {
+			cancels = append(cancels, TimerCancel{Tag: proposalBucket.timerTag})
+			proposalBucket.timerTag = ""
+		}
+	}
+	return cancels
 }
 
 func (p *proposer) hasOutstanding(bucket BucketID) bool {
@@ -0,0 +1,28 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package mirbft
+
+// request is a single client request, once it has made it through
+// preprocessing and is awaiting allocation to a proposal bucket.
+type request struct {
+	preprocessResult *PreprocessResult
+}
+
+// requestWindow holds the contiguous range of requests [lowWatermark,
+// highWatermark] a replica is willing to accept from a given client at a
+// time.
+type requestWindow struct {
+	lowWatermark  uint64
+	highWatermark uint64
+
+	requests map[uint64]*request
+}
+
+// request returns the request at reqNo, or nil if it hasn't arrived yet.
+func (rw *requestWindow) request(reqNo uint64) *request {
+	return rw.requests[reqNo]
+}
@@ -7,15 +7,27 @@ SPDX-License-Identifier: Apache-2.0
 package sample
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"hash"
+	"io"
 	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/IBM/mirbft"
 	pb "github.com/IBM/mirbft/mirbftpb"
 )
 
+// batchHashPool supplies the hash.Hash instances used to combine the
+// per-request digests of a batch into a single digest, so that path doesn't
+// need to allocate and concatenate a fresh []byte per batch.
+var batchHashPool = sync.Pool{
+	New: func() interface{} { return sha256.New() },
+}
+
 type ValidatorFunc func(*mirbft.PreprocessResult) error
 
 func (vf ValidatorFunc) Validate(preprocessResult *mirbft.PreprocessResult) error {
@@ -43,45 +55,92 @@ type Hasher interface {
 type Log interface {
 	Apply(*pb.QEntry)
 	Snap() (id []byte)
+
+	// SaveSnapshot persists a full snapshot of the application's state as of
+	// seqNo to w, for shipping to a lagging or newly-joined replica.
+	SaveSnapshot(seqNo uint64, w io.Writer) error
+
+	// LoadSnapshot restores the application's state from a snapshot
+	// previously produced by SaveSnapshot, returning the seqNo and id
+	// (as would have been returned by Snap at the time) it was taken at.
+	LoadSnapshot(r io.Reader) (seqNo uint64, id []byte, err error)
 }
 
+// windowSizeCheckpointMultiple sets the ring large enough to hold a few
+// checkpoint intervals' worth of in-flight, not-yet-checkpointed commits.
+const windowSizeCheckpointMultiple = 4
+
+// SerialCommitter tracks commits and checkpoints in a fixed-size ring rather
+// than the map[uint64]*pb.QEntry this package used to use, so steady-state
+// operation doesn't churn the garbage collector with one map entry per
+// committed seqno. WindowSize must be set to a positive value (NewSerialCommitter
+// derives one from NetworkConfig) before the first call to Commit.
 type SerialCommitter struct {
-	Log                    Log
-	LastCommittedSeqNo     uint64
-	OutstandingSeqNos      map[uint64]*pb.QEntry
-	OutstandingCheckpoints map[uint64]struct{}
+	Log                Log
+	LastCommittedSeqNo uint64
+	WindowSize         int
+
+	ring       []*pb.QEntry
+	present    []bool // present[seqNo%WindowSize] bitmap for ring
+	checkpoint []bool // checkpoint[seqNo%WindowSize] bitmap for pending checkpoints
+}
+
+// NewSerialCommitter builds a SerialCommitter with WindowSize derived from
+// networkConfig's checkpoint interval, rather than leaving callers to pick
+// (and risk forgetting to set) a ring size themselves.
+func NewSerialCommitter(log Log, networkConfig *pb.NetworkConfig) *SerialCommitter {
+	return &SerialCommitter{
+		Log:        log,
+		WindowSize: int(networkConfig.CheckpointInterval) * windowSizeCheckpointMultiple,
+	}
+}
+
+func (sc *SerialCommitter) ensureRing() {
+	if sc.ring != nil {
+		return
+	}
+	if sc.WindowSize <= 0 {
+		panic("SerialCommitter.WindowSize must be set to a positive value before Commit; use NewSerialCommitter")
+	}
+	sc.ring = make([]*pb.QEntry, sc.WindowSize)
+	sc.present = make([]bool, sc.WindowSize)
+	sc.checkpoint = make([]bool, sc.WindowSize)
 }
 
 func (sc *SerialCommitter) Commit(commits []*pb.QEntry, checkpoints []uint64) []*mirbft.CheckpointResult {
+	sc.ensureRing()
+
 	for _, commit := range commits {
-		// Note, this pattern is easy to understand, but memory inefficient.
-		// A ring buffer of size equal to the log size would produce far less
-		// garbage.
-		sc.OutstandingSeqNos[commit.SeqNo] = commit
+		slot := commit.SeqNo % uint64(sc.WindowSize)
+		sc.ring[slot] = commit
+		sc.present[slot] = true
 	}
 
 	for _, checkpoint := range checkpoints {
-		sc.OutstandingCheckpoints[checkpoint] = struct{}{}
+		sc.checkpoint[checkpoint%uint64(sc.WindowSize)] = true
 	}
 
 	results := []*mirbft.CheckpointResult{}
 
-	for currentSeqNo := sc.LastCommittedSeqNo + 1; len(sc.OutstandingSeqNos) > 0; currentSeqNo++ {
-		entry, ok := sc.OutstandingSeqNos[currentSeqNo]
-		if !ok {
+	for {
+		currentSeqNo := sc.LastCommittedSeqNo + 1
+		slot := currentSeqNo % uint64(sc.WindowSize)
+		if !sc.present[slot] || sc.ring[slot].SeqNo != currentSeqNo {
 			break
 		}
-		sc.Log.Apply(entry) // Apply the entry
+
+		sc.Log.Apply(sc.ring[slot]) // Apply the entry
 		sc.LastCommittedSeqNo = currentSeqNo
-		delete(sc.OutstandingSeqNos, currentSeqNo)
+		sc.ring[slot] = nil
+		sc.present[slot] = false
 
-		if _, ok := sc.OutstandingCheckpoints[currentSeqNo]; ok {
+		if sc.checkpoint[slot] {
 			value := sc.Log.Snap()
 			results = append(results, &mirbft.CheckpointResult{
 				SeqNo: sc.LastCommittedSeqNo,
 				Value: value,
 			})
-			delete(sc.OutstandingCheckpoints, currentSeqNo)
+			sc.checkpoint[slot] = false
 		}
 	}
 
@@ -142,12 +201,13 @@ func (c *SerialProcessor) Process(actions *mirbft.Actions) *mirbft.ActionResults
 	}
 
 	for i, batch := range actions.Process {
-		hashes := []byte{}
+		h := batchHashPool.Get().(hash.Hash)
+		h.Reset()
 		for _, preprocessResult := range batch.Proposals {
-			// TODO this could be much more efficient using
-			// the normal hash interface
-			hashes = append(hashes, preprocessResult.Digest...)
+			h.Write(preprocessResult.Digest)
 		}
+		digest := h.Sum(nil)
+		batchHashPool.Put(h)
 
 		valid := true
 		for _, preprocessResult := range batch.Proposals {
@@ -159,13 +219,34 @@ func (c *SerialProcessor) Process(actions *mirbft.Actions) *mirbft.ActionResults
 
 		actionResults.Processed[i] = mirbft.ProcessResult{
 			Batch:   batch,
-			Digest:  c.Hasher.Hash(hashes),
+			Digest:  digest,
 			Invalid: !valid,
 		}
 	}
 
 	actionResults.Checkpoints = c.Committer.Commit(actions.Commit, actions.Checkpoint)
 
+	if actions.SnapshotRequest != nil {
+		buf := &bytes.Buffer{}
+		if err := c.Committer.Log.SaveSnapshot(actions.SnapshotRequest.SeqNo, buf); err != nil {
+			panic(fmt.Sprintf("could not save snapshot at seqno %d: %s", actions.SnapshotRequest.SeqNo, err))
+		}
+
+		actionResults.SnapshotResult = &mirbft.SnapshotResult{
+			SeqNo: actions.SnapshotRequest.SeqNo,
+			Data:  buf.Bytes(),
+		}
+	}
+
+	if actions.SnapshotRestore != nil {
+		seqNo, _, err := c.Committer.Log.LoadSnapshot(bytes.NewReader(actions.SnapshotRestore.Data))
+		if err != nil {
+			panic(fmt.Sprintf("could not load restored snapshot: %s", err))
+		}
+		c.Committer.LastCommittedSeqNo = seqNo
+		c.Node.RestoreWatermarks(seqNo)
+	}
+
 	return actionResults
 }
 
@@ -0,0 +1,122 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package mirbft
+
+// SnapshotRequest is surfaced on Actions once the state machine reaches a
+// stable checkpoint and needs the application to durably persist its state
+// as of that seqno. The caller is expected to satisfy it by invoking
+// Log.SaveSnapshot and feeding the result back in via an ActionResults'
+// SnapshotResult, mirroring the existing Checkpoint/CheckpointResult flow.
+type SnapshotRequest struct {
+	SeqNo uint64
+}
+
+// SnapshotResult carries the bytes an application produced in response to a
+// SnapshotRequest back into the state machine.
+type SnapshotResult struct {
+	SeqNo uint64
+	Data  []byte
+}
+
+// SnapshotRestore asks the caller to install a snapshot this replica pulled
+// from a peer via state transfer, by calling Log.LoadSnapshot on Data and
+// resuming consensus at the seqno it reports.
+type SnapshotRestore struct {
+	Data []byte
+}
+
+// stateTransfer tracks a single attempt to catch a lagging or newly-joined
+// replica up by pulling a snapshot from f+1 peers, rather than replaying the
+// full log from the beginning. It is created once a replica observes
+// checkpoint values (via CheckpointResult.Value) that it cannot verify
+// locally, and is driven by the pb.Msg_StateTransfer request/chunk/done
+// messages exchanged over the usual Link (see Node.BeginStateTransfer and
+// Node's handling of incoming StateTransfer messages).
+type stateTransfer struct {
+	myConfig *Config
+
+	targetSeqNo uint64
+	targetValue []byte
+	sources     []NodeID
+
+	// chunks holds each source's chunks separately, keyed by source, so
+	// that interleaved responses from multiple sources (the expected case,
+	// since BeginStateTransfer asks every source at once) never get
+	// assembled into a mix-and-match snapshot.
+	chunks map[NodeID][][]byte
+}
+
+func newStateTransfer(myConfig *Config, targetSeqNo uint64, targetValue []byte, sources []NodeID) *stateTransfer {
+	return &stateTransfer{
+		myConfig:    myConfig,
+		targetSeqNo: targetSeqNo,
+		targetValue: targetValue,
+		sources:     sources,
+		chunks:      map[NodeID][][]byte{},
+	}
+}
+
+// addChunk records a chunk of snapshot data received from source, ignoring
+// it if source isn't one we actually asked.
+func (st *stateTransfer) addChunk(source NodeID, chunk []byte) {
+	if !st.isSource(source) {
+		return
+	}
+	st.chunks[source] = append(st.chunks[source], chunk)
+}
+
+func (st *stateTransfer) isSource(source NodeID) bool {
+	for _, s := range st.sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// finish assembles every chunk recorded so far from source into the full
+// snapshot, once source has signaled it sent the last one via
+// StateTransferDone. The caller is responsible for verifying the assembled
+// bytes hash to targetValue before installing them via Log.LoadSnapshot.
+func (st *stateTransfer) finish(source NodeID) []byte {
+	chunks := st.chunks[source]
+
+	total := 0
+	for _, c := range chunks {
+		total += len(c)
+	}
+
+	assembled := make([]byte, 0, total)
+	for _, c := range chunks {
+		assembled = append(assembled, c...)
+	}
+
+	return assembled
+}
+
+// restoreWatermarks reinitializes a proposer against the seqno a just-applied
+// snapshot was taken at. Anything already queued is built against a log
+// position we've now skipped past, so it's dropped; lastProcessed is fast
+// forwarded so stepRequestWindow resumes cutting batches from the restored
+// watermark instead of replaying requests the snapshot already subsumes.
+func restoreWatermarks(p *proposer, snapshotSeqNo uint64) {
+	for _, rwp := range p.requestWindowProcessors {
+		if rwp.lastProcessed < snapshotSeqNo {
+			rwp.lastProcessed = snapshotSeqNo
+		}
+	}
+
+	for _, bucket := range p.proposalBuckets {
+		bucket.queue = nil
+		bucket.sizeBytes = 0
+		bucket.pending = nil
+	}
+
+	// The dropped queues no longer need flushing; disarm their idle-flush
+	// timers so the next request into each bucket arms a fresh one.
+	p.pendingCancels = append(p.pendingCancels, p.Cancel()...)
+}
@@ -0,0 +1,30 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package mirbft
+
+import "time"
+
+// Timer is an action requesting that the caller of mirbft.Node arm a
+// one-shot timer under Tag and, once Duration has elapsed, deliver it back
+// to the state machine by calling Node.TimerFired(Tag).
+type Timer struct {
+	Tag      string
+	Duration time.Duration
+}
+
+// TimerCancel requests that the caller disarm a previously armed Timer with
+// the same Tag, because whatever it was waiting to flush has already been
+// cut for another reason.
+type TimerCancel struct {
+	Tag string
+}
+
+// TimerFired names, by Tag, a Timer armed via Actions.Timers that has
+// elapsed. Node.TimerFired takes the Tag string itself, not this type.
+type TimerFired struct {
+	Tag string
+}